@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusReporter is a Reporter backed by Prometheus counters, gauges,
+// and a histogram, registered under the `redutil` namespace.
+type PrometheusReporter struct {
+	queuePush  *prometheus.CounterVec
+	queuePull  *prometheus.CounterVec
+	queueDepth *prometheus.GaugeVec
+
+	pubsubSubscribers *prometheus.GaugeVec
+	pubsubMessages    *prometheus.CounterVec
+	pubsubReconnects  prometheus.Counter
+	handleEventTiming prometheus.Histogram
+}
+
+// NewPrometheusReporter creates a PrometheusReporter and registers its
+// collectors against reg.
+func NewPrometheusReporter(reg prometheus.Registerer) *PrometheusReporter {
+	r := &PrometheusReporter{
+		queuePush: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "redutil",
+			Subsystem: "queue",
+			Name:      "push_total",
+			Help:      "Total number of values pushed onto a queue keyspace.",
+		}, []string{"keyspace"}),
+		queuePull: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "redutil",
+			Subsystem: "queue",
+			Name:      "pull_total",
+			Help:      "Total number of values pulled from a queue keyspace.",
+		}, []string{"keyspace"}),
+		queueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "redutil",
+			Subsystem: "queue",
+			Name:      "depth",
+			Help:      "Current length of a queue keyspace, as sampled via LLEN.",
+		}, []string{"keyspace"}),
+		pubsubSubscribers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "redutil",
+			Subsystem: "pubsub",
+			Name:      "subscribers",
+			Help:      "Current number of active subscribers, by event type.",
+		}, []string{"type"}),
+		pubsubMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "redutil",
+			Subsystem: "pubsub",
+			Name:      "messages_received_total",
+			Help:      "Total number of pubsub messages received, by event type.",
+		}, []string{"type"}),
+		pubsubReconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "redutil",
+			Subsystem: "pubsub",
+			Name:      "reconnects_total",
+			Help:      "Total number of times the pubsub connection was re-established.",
+		}),
+		handleEventTiming: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "redutil",
+			Subsystem: "pubsub",
+			Name:      "handle_event_seconds",
+			Help:      "Time spent dispatching a single received event to its listeners.",
+		}),
+	}
+
+	reg.MustRegister(
+		r.queuePush, r.queuePull, r.queueDepth,
+		r.pubsubSubscribers, r.pubsubMessages, r.pubsubReconnects, r.handleEventTiming,
+	)
+
+	return r
+}
+
+func (r *PrometheusReporter) IncQueuePush(keyspace string) {
+	r.queuePush.WithLabelValues(keyspace).Inc()
+}
+func (r *PrometheusReporter) IncQueuePull(keyspace string) {
+	r.queuePull.WithLabelValues(keyspace).Inc()
+}
+func (r *PrometheusReporter) SetQueueDepth(keyspace string, depth int) {
+	r.queueDepth.WithLabelValues(keyspace).Set(float64(depth))
+}
+
+func (r *PrometheusReporter) IncPubsubSubscribers(eventType string, delta int) {
+	r.pubsubSubscribers.WithLabelValues(eventType).Add(float64(delta))
+}
+
+func (r *PrometheusReporter) IncPubsubMessagesReceived(eventType string) {
+	r.pubsubMessages.WithLabelValues(eventType).Inc()
+}
+
+func (r *PrometheusReporter) IncPubsubReconnects() { r.pubsubReconnects.Inc() }
+
+func (r *PrometheusReporter) ObserveHandleEventDuration(d time.Duration) {
+	r.handleEventTiming.Observe(d.Seconds())
+}
+
+var _ Reporter = new(PrometheusReporter)
@@ -0,0 +1,52 @@
+// Package metrics defines the reporting interface redutil's queue and
+// pubsub subsystems emit operational counters through, so that callers can
+// plug in Prometheus, another backend, or nothing at all.
+package metrics
+
+import "time"
+
+// Reporter receives the operational counters redutil's subsystems emit.
+// Implementations must be safe for concurrent use.
+//
+// The queue.FIFO/queue.LIFO processors and queue.BaseQueue aren't present in
+// this checkout (only their test files are), so nothing calls the
+// IncQueuePush/IncQueuePull/SetQueueDepth methods below yet - they're
+// defined ahead of that package landing here so its constructors can take a
+// Reporter the same way NewPubsubEmitter does, without another interface
+// change.
+type Reporter interface {
+	// IncQueuePush records a single push onto keyspace.
+	IncQueuePush(keyspace string)
+	// IncQueuePull records a single pull from keyspace.
+	IncQueuePull(keyspace string)
+	// SetQueueDepth records the current length of keyspace, as sampled via
+	// LLEN.
+	SetQueueDepth(keyspace string, depth int)
+
+	// IncPubsubSubscribers adjusts the current number of active
+	// subscribers for the given event type ("plain" or "pattern") by
+	// delta.
+	IncPubsubSubscribers(eventType string, delta int)
+	// IncPubsubMessagesReceived records a single message received for the
+	// given event type.
+	IncPubsubMessagesReceived(eventType string)
+	// IncPubsubReconnects records a single pubsub connection reconnect.
+	IncPubsubReconnects()
+	// ObserveHandleEventDuration records how long a single dispatch of a
+	// received event to its listeners took.
+	ObserveHandleEventDuration(d time.Duration)
+}
+
+// NoopReporter is a Reporter that discards everything it's given. It's the
+// default used when no Reporter is configured.
+type NoopReporter struct{}
+
+func (NoopReporter) IncQueuePush(string)                      {}
+func (NoopReporter) IncQueuePull(string)                      {}
+func (NoopReporter) SetQueueDepth(string, int)                {}
+func (NoopReporter) IncPubsubSubscribers(string, int)         {}
+func (NoopReporter) IncPubsubMessagesReceived(string)         {}
+func (NoopReporter) IncPubsubReconnects()                     {}
+func (NoopReporter) ObserveHandleEventDuration(time.Duration) {}
+
+var _ Reporter = NoopReporter{}
@@ -0,0 +1,15 @@
+package metrics
+
+import "testing"
+
+func TestNoopReporterSatisfiesReporter(t *testing.T) {
+	var r Reporter = NoopReporter{}
+
+	r.IncQueuePush("keyspace")
+	r.IncQueuePull("keyspace")
+	r.SetQueueDepth("keyspace", 5)
+	r.IncPubsubSubscribers("plain", 1)
+	r.IncPubsubMessagesReceived("plain")
+	r.IncPubsubReconnects()
+	r.ObserveHandleEventDuration(0)
+}
@@ -0,0 +1,124 @@
+package pubsub
+
+// Fireable is implemented by anything that can publish an event, such as
+// PubsubEmitter via FireEvent. EventCache wraps a Fireable to batch calls
+// to it.
+type Fireable interface {
+	FireEvent(ev Event, data []byte) error
+}
+
+// BatchFireable is implemented by a Fireable that can accept many events in
+// one call instead of one at a time. When the target EventCache wraps
+// implements it, Flush uses FireBatch to release the whole buffer in a
+// single call instead of calling FireEvent once per buffered event.
+type BatchFireable interface {
+	Fireable
+
+	FireBatch(msgs []Message) error
+}
+
+// FireEvent implements Fireable, delegating to Publish with no tags
+// attached.
+func (p *PubsubEmitter) FireEvent(ev Event, data []byte) error {
+	return p.Publish(ev, data, nil)
+}
+
+// FireBatch implements BatchFireable, publishing every message in turn. It
+// exists so a flushing EventCache only has to make one call into its target
+// instead of one per buffered event; Redis has no batch-publish command, so
+// each message is still its own PUBLISH.
+func (p *PubsubEmitter) FireBatch(msgs []Message) error {
+	for _, msg := range msgs {
+		if err := p.Publish(msg.Event, msg.Data, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var _ BatchFireable = new(PubsubEmitter)
+
+// cachedEvent pairs an Event with the payload passed to FireEvent, queued
+// for a later Flush.
+type cachedEvent struct {
+	ev   Event
+	data []byte
+}
+
+// EventCache buffers events queued via FireEvent and releases them to the
+// wrapped Fireable only when Flush is called, discarding them instead on
+// Reset. This lets a caller stage many events during a unit of work (e.g. a
+// queue transaction) and emit them atomically only when the work commits.
+//
+// EventCache is not safe for concurrent use and does no locking of its own;
+// it's intended to be owned by the single goroutine driving the unit of
+// work it batches.
+type EventCache struct {
+	target Fireable
+	cache  []cachedEvent
+}
+
+var _ Fireable = new(EventCache)
+
+// NewEventCache creates an EventCache that flushes into target.
+func NewEventCache(target Fireable) *EventCache {
+	return &EventCache{target: target}
+}
+
+// FireEvent implements Fireable, buffering ev and data instead of firing
+// them immediately.
+func (c *EventCache) FireEvent(ev Event, data []byte) error {
+	c.cache = append(c.cache, cachedEvent{ev: ev, data: data})
+	return nil
+}
+
+// Flush fires every buffered event, in the order FireEvent queued them,
+// against the wrapped Fireable, then empties the buffer. If the target
+// implements BatchFireable, the whole buffer is released through a single
+// FireBatch call instead of one FireEvent call per event; otherwise Flush
+// falls back to firing them one at a time, stopping and returning the
+// error if one fails and leaving the remaining events buffered for a
+// retry. A failed FireBatch call leaves the entire buffer in place for a
+// retry, since there's no way to tell how much of the batch landed.
+func (c *EventCache) Flush() error {
+	if len(c.cache) == 0 {
+		return nil
+	}
+
+	if target, ok := c.target.(BatchFireable); ok {
+		return c.flushBatch(target)
+	}
+
+	for len(c.cache) > 0 {
+		cached := c.cache[0]
+		if err := c.target.FireEvent(cached.ev, cached.data); err != nil {
+			return err
+		}
+
+		c.cache = c.cache[1:]
+	}
+
+	return nil
+}
+
+// flushBatch releases the whole buffer through a single call to target's
+// FireBatch.
+func (c *EventCache) flushBatch(target BatchFireable) error {
+	msgs := make([]Message, len(c.cache))
+	for i, cached := range c.cache {
+		msgs[i] = Message{Event: cached.ev, Data: cached.data}
+	}
+
+	if err := target.FireBatch(msgs); err != nil {
+		return err
+	}
+
+	c.cache = nil
+	return nil
+}
+
+// Reset discards the buffer without firing any of its events.
+func (c *EventCache) Reset() {
+	c.cache = nil
+}
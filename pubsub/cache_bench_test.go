@@ -0,0 +1,102 @@
+package pubsub
+
+import "testing"
+
+// chanFireable emulates the channel-send overhead of PubsubEmitter.send: it
+// funnels fired events through an unbuffered channel drained by a worker
+// goroutine, the same shape as the real `p.send` path. Unlike
+// PubsubEmitter.FireBatch, which still issues one PUBLISH per message since
+// Redis has no batch-publish command, this fake's FireBatch funnels its
+// whole slice through in a single send, to isolate and measure the
+// channel-send overhead EventCache's BatchFireable path is meant to save.
+type chanFireable struct {
+	send  chan cachedEvent
+	batch chan []cachedEvent
+	done  chan struct{}
+}
+
+func newChanFireable() *chanFireable {
+	f := &chanFireable{
+		send:  make(chan cachedEvent),
+		batch: make(chan []cachedEvent),
+		done:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(f.done)
+
+		send, batch := f.send, f.batch
+		for send != nil || batch != nil {
+			select {
+			case _, ok := <-send:
+				if !ok {
+					send = nil
+				}
+			case _, ok := <-batch:
+				if !ok {
+					batch = nil
+				}
+			}
+		}
+	}()
+
+	return f
+}
+
+func (f *chanFireable) FireEvent(ev Event, data []byte) error {
+	f.send <- cachedEvent{ev: ev, data: data}
+	return nil
+}
+
+func (f *chanFireable) FireBatch(msgs []Message) error {
+	batch := make([]cachedEvent, len(msgs))
+	for i, msg := range msgs {
+		batch[i] = cachedEvent{ev: msg.Event, data: msg.Data}
+	}
+
+	f.batch <- batch
+	return nil
+}
+
+func (f *chanFireable) close() {
+	close(f.send)
+	close(f.batch)
+	<-f.done
+}
+
+var _ BatchFireable = new(chanFireable)
+
+const benchEventCount = 1000
+
+// BenchmarkFireEventOneByOne sends every event straight to the channel,
+// paying its send/schedule overhead on each call.
+func BenchmarkFireEventOneByOne(b *testing.B) {
+	ev := NewEvent("bench")
+
+	for i := 0; i < b.N; i++ {
+		f := newChanFireable()
+		for j := 0; j < benchEventCount; j++ {
+			f.FireEvent(ev, nil)
+		}
+		f.close()
+	}
+}
+
+// BenchmarkFireEventThroughCache stages the same events in an EventCache
+// and releases them in a single Flush. Since chanFireable implements
+// BatchFireable, Flush calls FireBatch once instead of FireEvent
+// benchEventCount times, paying the channel-send overhead once per b.N
+// iteration instead of once per event.
+func BenchmarkFireEventThroughCache(b *testing.B) {
+	ev := NewEvent("bench")
+
+	for i := 0; i < b.N; i++ {
+		f := newChanFireable()
+		cache := NewEventCache(f)
+		for j := 0; j < benchEventCount; j++ {
+			cache.FireEvent(ev, nil)
+		}
+		cache.Flush()
+		f.close()
+	}
+}
@@ -0,0 +1,81 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingFireable struct {
+	fired []cachedEvent
+}
+
+func (r *recordingFireable) FireEvent(ev Event, data []byte) error {
+	r.fired = append(r.fired, cachedEvent{ev: ev, data: data})
+	return nil
+}
+
+func TestEventCacheBuffersUntilFlush(t *testing.T) {
+	target := &recordingFireable{}
+	cache := NewEventCache(target)
+
+	cache.FireEvent(NewEvent("one"), []byte("1"))
+	cache.FireEvent(NewEvent("two"), []byte("2"))
+	assert.Empty(t, target.fired)
+
+	assert.NoError(t, cache.Flush())
+	assert.Len(t, target.fired, 2)
+	assert.Equal(t, "one", target.fired[0].ev.Name())
+	assert.Equal(t, "two", target.fired[1].ev.Name())
+}
+
+func TestEventCacheResetDropsWithoutFiring(t *testing.T) {
+	target := &recordingFireable{}
+	cache := NewEventCache(target)
+
+	cache.FireEvent(NewEvent("one"), []byte("1"))
+	cache.Reset()
+
+	assert.NoError(t, cache.Flush())
+	assert.Empty(t, target.fired)
+}
+
+type recordingBatchFireable struct {
+	recordingFireable
+	batches [][]Message
+}
+
+func (r *recordingBatchFireable) FireBatch(msgs []Message) error {
+	r.batches = append(r.batches, msgs)
+	return nil
+}
+
+func TestEventCacheFlushUsesFireBatchWhenAvailable(t *testing.T) {
+	target := &recordingBatchFireable{}
+	cache := NewEventCache(target)
+
+	cache.FireEvent(NewEvent("one"), []byte("1"))
+	cache.FireEvent(NewEvent("two"), []byte("2"))
+
+	assert.NoError(t, cache.Flush())
+	assert.Empty(t, target.fired, "should not have fallen back to FireEvent")
+	assert.Len(t, target.batches, 1)
+	assert.Len(t, target.batches[0], 2)
+	assert.Equal(t, "one", target.batches[0][0].Event.Name())
+	assert.Equal(t, "two", target.batches[0][1].Event.Name())
+
+	assert.Empty(t, cache.cache, "Flush should empty the buffer")
+}
+
+type erroringBatchFireable struct{ recordingFireable }
+
+func (erroringBatchFireable) FireBatch([]Message) error { return assert.AnError }
+
+func TestEventCacheFlushLeavesBufferOnFireBatchError(t *testing.T) {
+	cache := NewEventCache(&erroringBatchFireable{})
+
+	cache.FireEvent(NewEvent("one"), []byte("1"))
+
+	assert.Error(t, cache.Flush())
+	assert.Len(t, cache.cache, 1, "failed batch should leave the buffer intact for retry")
+}
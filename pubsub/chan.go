@@ -0,0 +1,151 @@
+package pubsub
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Message is delivered over a channel-based Subscription for every event it
+// receives.
+type Message struct {
+	Event Event
+	Data  []byte
+}
+
+// Subscription is a channel-based alternative to the Listener callback API,
+// covering one or more Events registered via PubsubEmitter.SubscribeChan.
+type Subscription interface {
+	// Chan returns the channel new Messages are delivered on.
+	Chan() <-chan Message
+	// Err returns a channel that yields an error when a message could not
+	// be delivered, such as when it was dropped because the consumer
+	// wasn't keeping up.
+	Err() <-chan error
+	// Unsubscribe removes the Subscription from every Event it covers and
+	// closes the channels returned by Chan and Err. It's safe to call more
+	// than once.
+	Unsubscribe()
+}
+
+// chanSubscription implements Subscription by adapting a Listener into a
+// pair of buffered channels.
+type chanSubscription struct {
+	p      *PubsubEmitter
+	events []Event
+	block  bool
+
+	msgs chan Message
+	errs chan error
+
+	// mu guards stopped: the emitter dispatches to a Listener from a
+	// snapshot of the subscriber list taken before a concurrent
+	// Unsubscribe removes it, so a call to Handle can still arrive after
+	// s.p.Unsubscribe has returned. inflight tracks such in-progress
+	// Handle calls so Unsubscribe can wait for them to finish before
+	// closing msgs/errs out from under them. stopCh is closed alongside
+	// stopped so a Handle call already blocked sending on msgs (block set,
+	// no one reading Chan()) is released instead of leaving Unsubscribe
+	// waiting on it forever.
+	mu       sync.Mutex
+	stopped  bool
+	stopCh   chan struct{}
+	inflight sync.WaitGroup
+
+	closeOnce sync.Once
+}
+
+var _ Subscription = (*chanSubscription)(nil)
+var _ Listener = (*chanSubscription)(nil)
+
+// Handle implements Listener, delivering ev and b on Chan(). If block was
+// set when the subscription was created, Handle blocks the emitter's
+// dispatch goroutine until the consumer drains Chan() or Unsubscribe is
+// called, whichever comes first; otherwise a full channel causes the
+// message to be dropped, and reported on Err() if Err()'s one-slot buffer
+// is empty (a drop while an earlier error is still unread is not
+// reported). Handle is a no-op once
+// Unsubscribe has been called, even if it was already in flight when
+// Unsubscribe started closing the channels.
+func (s *chanSubscription) Handle(ev Event, b []byte) {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.inflight.Add(1)
+	s.mu.Unlock()
+	defer s.inflight.Done()
+
+	msg := Message{Event: ev, Data: b}
+
+	if s.block {
+		select {
+		case s.msgs <- msg:
+		case <-s.stopCh:
+		}
+		return
+	}
+
+	select {
+	case s.msgs <- msg:
+	default:
+		select {
+		case s.errs <- fmt.Errorf("pubsub: dropped message for %q, consumer too slow", ev.Name()):
+		default:
+		}
+	}
+}
+
+// Chan implements Subscription.
+func (s *chanSubscription) Chan() <-chan Message { return s.msgs }
+
+// Err implements Subscription.
+func (s *chanSubscription) Err() <-chan error { return s.errs }
+
+// Unsubscribe implements Subscription.
+func (s *chanSubscription) Unsubscribe() {
+	s.closeOnce.Do(func() {
+		for _, ev := range s.events {
+			s.p.Unsubscribe(ev, s)
+		}
+
+		s.mu.Lock()
+		s.stopped = true
+		s.mu.Unlock()
+		close(s.stopCh)
+
+		// Wait for any Handle call that had already passed the stopped
+		// check above before it was set, so it finishes sending to
+		// msgs/errs before we close them. Closing stopCh above releases
+		// one that was blocked on a full msgs channel with no reader.
+		s.inflight.Wait()
+
+		close(s.msgs)
+		close(s.errs)
+	})
+}
+
+// SubscribeChan registers a channel-based Subscription covering one or more
+// Events, for select-driven consumers that would rather range over
+// Subscription.Chan() than implement Listener. buf sets the capacity of the
+// channel returned by Chan(); once full, further messages are dropped (and
+// reported via Err(), which holds at most one unread error) unless block is
+// true, in which case Handle blocks the
+// emitter's dispatch goroutine until the consumer catches up. The existing
+// Subscribe/Listener API is unaffected.
+func (p *PubsubEmitter) SubscribeChan(buf int, block bool, evs ...Event) Subscription {
+	sub := &chanSubscription{
+		p:      p,
+		events: evs,
+		block:  block,
+		msgs:   make(chan Message, buf),
+		errs:   make(chan error, 1),
+		stopCh: make(chan struct{}),
+	}
+
+	for _, ev := range evs {
+		p.Subscribe(ev, sub)
+	}
+
+	return sub
+}
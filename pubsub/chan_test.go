@@ -0,0 +1,155 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/redutil/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChanSubscriptionDeliversMessages(t *testing.T) {
+	sub := &chanSubscription{msgs: make(chan Message, 2), errs: make(chan error, 1)}
+
+	ev := NewEvent("foo")
+	sub.Handle(ev, []byte("bar"))
+
+	msg := <-sub.Chan()
+	assert.Equal(t, "foo", msg.Event.Name())
+	assert.Equal(t, []byte("bar"), msg.Data)
+}
+
+func TestChanSubscriptionDropsWhenFull(t *testing.T) {
+	sub := &chanSubscription{msgs: make(chan Message, 1), errs: make(chan error, 1)}
+
+	ev := NewEvent("foo")
+	sub.Handle(ev, nil)
+	sub.Handle(ev, nil)
+
+	select {
+	case <-sub.Err():
+	default:
+		t.Fatal("expected a dropped-message error on Err()")
+	}
+}
+
+func TestChanSubscriptionBlocksWhenConfigured(t *testing.T) {
+	sub := &chanSubscription{msgs: make(chan Message, 1), errs: make(chan error, 1), block: true}
+	ev := NewEvent("foo")
+
+	sub.Handle(ev, nil)
+
+	done := make(chan struct{})
+	go func() {
+		sub.Handle(ev, nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected Handle to block until the channel drained")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	<-sub.Chan()
+	<-done
+}
+
+// noopListener is kept subscribed alongside the chanSubscription under test
+// in the tests below, so that removing the chanSubscription doesn't leave
+// ev with zero listeners - which would make PubsubEmitter.Unsubscribe send
+// an UNSUBSCRIBE command, and these tests don't run a real emitter loop to
+// consume it.
+type noopListener struct{}
+
+func (noopListener) Handle(Event, []byte) {}
+
+func newTestEmitter() *PubsubEmitter {
+	return &PubsubEmitter{
+		reporter: metrics.NoopReporter{},
+		send:     make(chan command, 10),
+		subs: []*recordList{
+			PlainEvent:   &recordList{},
+			PatternEvent: &recordList{},
+		},
+	}
+}
+
+func TestChanSubscriptionUnsubscribeClosesChannelsOnce(t *testing.T) {
+	p := newTestEmitter()
+	ev := NewEvent("foo")
+
+	sub := &chanSubscription{
+		p: p, events: []Event{ev},
+		msgs: make(chan Message), errs: make(chan error), stopCh: make(chan struct{}),
+	}
+	p.Subscribe(ev, sub)
+	p.Subscribe(ev, noopListener{})
+
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+
+	_, ok := <-sub.Chan()
+	assert.False(t, ok)
+}
+
+func TestChanSubscriptionUnsubscribeDoesNotPanicOnInFlightHandle(t *testing.T) {
+	p := newTestEmitter()
+	ev := NewEvent("foo")
+
+	sub := &chanSubscription{
+		p: p, events: []Event{ev}, block: true,
+		msgs: make(chan Message, 1), errs: make(chan error, 1), stopCh: make(chan struct{}),
+	}
+	p.Subscribe(ev, sub)
+	p.Subscribe(ev, noopListener{})
+
+	// Simulate PubsubEmitter.handleEvent's dispatch: it takes a FindCopy
+	// snapshot of the listener list under subsMu, then calls Handle on it
+	// outside the lock. Take that snapshot here, then let Unsubscribe run
+	// to completion - removing sub and closing its channels - before the
+	// "in-flight" Handle call from the stale snapshot runs.
+	p.subsMu.Lock()
+	rec := p.subs[PlainEvent].FindCopy(ev.Name())
+	p.subsMu.Unlock()
+
+	sub.Unsubscribe()
+
+	assert.NotPanics(t, func() {
+		rec.Emit(ev, []byte("stale"), nil)
+	})
+}
+
+func TestChanSubscriptionUnsubscribeDoesNotDeadlockOnBlockedHandle(t *testing.T) {
+	p := newTestEmitter()
+	ev := NewEvent("foo")
+
+	sub := &chanSubscription{
+		p: p, events: []Event{ev}, block: true,
+		msgs: make(chan Message), errs: make(chan error, 1), stopCh: make(chan struct{}),
+	}
+	p.Subscribe(ev, sub)
+	p.Subscribe(ev, noopListener{})
+
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		// Nothing ever reads sub.Chan(), so this blocks until Unsubscribe
+		// releases it via stopCh.
+		sub.Handle(ev, []byte("stuck"))
+	}()
+	<-started
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		sub.Unsubscribe()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Unsubscribe deadlocked waiting on a Handle call blocked with no reader")
+	}
+}
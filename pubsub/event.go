@@ -2,6 +2,7 @@ package pubsub
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -39,6 +40,19 @@ func (e EventType) UnsubCommand() string {
 	}
 }
 
+// String returns a short, human-readable name for the event type, used as
+// the `type` label when reporting pubsub metrics.
+func (e EventType) String() string {
+	switch e {
+	case PlainEvent:
+		return "plain"
+	case PatternEvent:
+		return "pattern"
+	default:
+		return "unknown"
+	}
+}
+
 // Fields are concatenated into events which can
 // be listened to over liveloading.
 type Field struct {
@@ -81,8 +95,14 @@ func String(str string) Field { return Field{valid: true, value: str} }
 // Int creates and returns a Field containing an integer.
 func Int(x int) Field { return Field{valid: true, value: strconv.Itoa(x)} }
 
+// starValue is the Field value used to mark a wildcard inserted by Star().
+const starValue = "*"
+
 // Star returns a field containing the Kleene star `*` for pattern subscription.
-func Star() Field { return Field{valid: true, value: "*"} }
+func Star() Field { return Field{valid: true, value: starValue} }
+
+// isStar returns true if the field represents a Star() wildcard.
+func (f Field) isStar() bool { return f.value == starValue }
 
 // An Event is passed to an Emitter to manage which
 // events a Listener is subscribed to.
@@ -165,3 +185,67 @@ func NewPatternEvent(name interface{}, fields ...Field) Event {
 		kind:   PatternEvent,
 	}
 }
+
+// regexp compiles the pattern event's fields into a regular expression that
+// matches concrete channel names delivered by Redis's PMessage, capturing
+// one group per Star() field in field order.
+func (e Event) regexp() *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteByte('^')
+
+	for _, field := range e.fields {
+		if field.isStar() {
+			pattern.WriteString("(.*)")
+			continue
+		}
+
+		pattern.WriteString(regexp.QuoteMeta(field.value))
+	}
+
+	pattern.WriteByte('$')
+	return regexp.MustCompile(pattern.String())
+}
+
+// prefix returns the literal portion of a pattern event up to, but not
+// including, its first Star() field. StreamEmitter uses this to discover
+// the concrete stream keys a pattern subscription should cover via SCAN.
+func (e Event) prefix() string {
+	var buf strings.Builder
+
+	for _, field := range e.fields {
+		if field.isStar() {
+			break
+		}
+
+		buf.WriteString(field.value)
+	}
+
+	return buf.String()
+}
+
+// match attempts to match channel, the concrete channel name a PMessage was
+// received on, against the pattern event e. On success it returns a new
+// Event whose Star() fields have been replaced with the segment of channel
+// they matched, keeping the alias set via Field.As so that Event.Find still
+// resolves it. The second return value is false if channel does not match
+// the pattern.
+func (e Event) match(channel string) (Event, bool) {
+	groups := e.regexp().FindStringSubmatch(channel)
+	if groups == nil {
+		return Event{}, false
+	}
+
+	fields := make([]Field, len(e.fields))
+	group := 1
+	for i, field := range e.fields {
+		if !field.isStar() {
+			fields[i] = field
+			continue
+		}
+
+		fields[i] = String(groups[group]).As(field.alias)
+		group++
+	}
+
+	return Event{fields: fields, kind: e.kind}, true
+}
@@ -8,15 +8,15 @@ import (
 
 func TestEventBuildsString(t *testing.T) {
 	e := NewEvent("foo")
-	assert.Equal(t, e.sub, "SUBSCRIBE")
-	assert.Equal(t, e.unsub, "UNSUBSCRIBE")
+	assert.Equal(t, e.Type().SubCommand(), "SUBSCRIBE")
+	assert.Equal(t, e.Type().UnsubCommand(), "UNSUBSCRIBE")
 	assert.Equal(t, e.Name(), "foo")
 }
 
 func TestEventBuildsPattern(t *testing.T) {
 	e := NewPatternEvent("foo")
-	assert.Equal(t, e.sub, "PSUBSCRIBE")
-	assert.Equal(t, e.unsub, "PUNSUBSCRIBE")
+	assert.Equal(t, e.Type().SubCommand(), "PSUBSCRIBE")
+	assert.Equal(t, e.Type().UnsubCommand(), "PUNSUBSCRIBE")
 	assert.Equal(t, e.Name(), "foo")
 }
 
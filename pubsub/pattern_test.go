@@ -0,0 +1,58 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventMatchesSingleStar(t *testing.T) {
+	e := NewPatternEvent("user:", Star().As("id"), String(":msg"))
+
+	ev, ok := e.match("user:42:msg")
+	assert.True(t, ok)
+	assert.Equal(t, "42", ev.Find("id").String())
+}
+
+func TestEventMatchesMultipleStars(t *testing.T) {
+	e := NewPatternEvent("user:", Star().As("id"), String(":room:"), Star().As("room"), String(":msg"))
+
+	ev, ok := e.match("user:42:room:general:msg")
+	assert.True(t, ok)
+	assert.Equal(t, "42", ev.Find("id").String())
+	assert.Equal(t, "general", ev.Find("room").String())
+}
+
+func TestEventMatchesAdjacentLiteralFields(t *testing.T) {
+	e := NewPatternEvent("user:", String("v1:"), Star().As("id"))
+
+	ev, ok := e.match("user:v1:42")
+	assert.True(t, ok)
+	assert.Equal(t, "42", ev.Find("id").String())
+}
+
+func TestEventMatchFailsOnMismatch(t *testing.T) {
+	e := NewPatternEvent("user:", Star().As("id"), String(":msg"))
+
+	_, ok := e.match("user:42:edit")
+	assert.False(t, ok)
+}
+
+func TestEventMatchPreservesLiteralFields(t *testing.T) {
+	e := NewPatternEvent("user:", Star().As("id"), String(":msg"))
+
+	ev, ok := e.match("user:42:msg")
+	assert.True(t, ok)
+	assert.Equal(t, "user:42:msg", ev.Name())
+}
+
+func TestEventOverlapsPlainAndPatternSubscriptions(t *testing.T) {
+	plain := NewEvent("user:42:msg")
+	pattern := NewPatternEvent("user:", Star().As("id"), String(":msg"))
+
+	assert.Equal(t, "user:42:msg", plain.Name())
+
+	ev, ok := pattern.match("user:42:msg")
+	assert.True(t, ok)
+	assert.Equal(t, "42", ev.Find("id").String())
+}
@@ -0,0 +1,69 @@
+package pubsub
+
+import "strings"
+
+// Query is a boolean predicate evaluated against the tags a publisher
+// attaches to an event via Emitter.Publish. It lets a SubscribeWithQuery
+// listener filter events more granularly than by channel name alone.
+type Query interface {
+	// Matches returns true if tags satisfies the query.
+	Matches(tags map[string]string) bool
+}
+
+// Empty is a Query that matches every set of tags. It's the Query used by
+// Subscribe, which has no filtering behavior of its own.
+type Empty struct{}
+
+// Matches implements Query.
+func (Empty) Matches(tags map[string]string) bool { return true }
+
+// QueryFunc adapts a plain function into a Query.
+type QueryFunc func(tags map[string]string) bool
+
+// Matches implements Query.
+func (f QueryFunc) Matches(tags map[string]string) bool { return f(tags) }
+
+// operator is a comparison an AST condition evaluates between a tag's value
+// and a literal.
+type operator int
+
+const (
+	opEQ operator = iota
+	opLT
+	opGT
+	opLTE
+	opGTE
+	opContains
+)
+
+// condition is a leaf of a compiled Query: `tag <op> value`.
+type condition struct {
+	tag   string
+	op    operator
+	value string
+}
+
+// Matches implements Query.
+func (c condition) Matches(tags map[string]string) bool {
+	v, ok := tags[c.tag]
+	if !ok {
+		return false
+	}
+
+	switch c.op {
+	case opEQ:
+		return v == c.value
+	case opContains:
+		return strings.Contains(v, c.value)
+	default:
+		return c.compareOrdered(v)
+	}
+}
+
+// and is a Query requiring both of its operands to match.
+type and struct{ left, right Query }
+
+// Matches implements Query.
+func (a and) Matches(tags map[string]string) bool {
+	return a.left.Matches(tags) && a.right.Matches(tags)
+}
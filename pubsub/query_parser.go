@@ -0,0 +1,126 @@
+package pubsub
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryTokenPattern splits a query expression into quoted string literals,
+// the two-character comparison operators, and everything else (identifiers,
+// bare literals, single-character operators, and the AND keyword).
+var queryTokenPattern = regexp.MustCompile(`'[^']*'|<=|>=|\S+`)
+
+// ParseQuery compiles a tendermint pubsub-style query expression, e.g.
+// `tx.height > 5 AND tx.hash = 'abc'`, into a Query usable with
+// PubsubEmitter.SubscribeWithQuery. Supported operators are =, <, >, <=, >=
+// and CONTAINS, joined with AND. An empty expression matches everything.
+func ParseQuery(src string) (Query, error) {
+	tokens := queryTokenPattern.FindAllString(src, -1)
+	if len(tokens) == 0 {
+		return Empty{}, nil
+	}
+
+	var query Query
+	for len(tokens) > 0 {
+		if query != nil {
+			if !strings.EqualFold(tokens[0], "AND") {
+				return nil, fmt.Errorf("pubsub: expected AND, got %q", tokens[0])
+			}
+			tokens = tokens[1:]
+		}
+
+		cond, rest, err := parseCondition(tokens)
+		if err != nil {
+			return nil, err
+		}
+		tokens = rest
+
+		if query == nil {
+			query = cond
+		} else {
+			query = and{left: query, right: cond}
+		}
+	}
+
+	return query, nil
+}
+
+// parseCondition consumes a single `tag op value` triple off the front of
+// tokens, returning the rest of the tokens for the caller to continue with.
+func parseCondition(tokens []string) (condition, []string, error) {
+	if len(tokens) < 3 {
+		return condition{}, nil, fmt.Errorf("pubsub: malformed condition near %q", strings.Join(tokens, " "))
+	}
+
+	op, err := parseOperator(tokens[1])
+	if err != nil {
+		return condition{}, nil, err
+	}
+
+	return condition{tag: tokens[0], op: op, value: unquote(tokens[2])}, tokens[3:], nil
+}
+
+func parseOperator(tok string) (operator, error) {
+	switch strings.ToUpper(tok) {
+	case "=":
+		return opEQ, nil
+	case "<":
+		return opLT, nil
+	case ">":
+		return opGT, nil
+	case "<=":
+		return opLTE, nil
+	case ">=":
+		return opGTE, nil
+	case "CONTAINS":
+		return opContains, nil
+	default:
+		return 0, fmt.Errorf("pubsub: unknown operator %q", tok)
+	}
+}
+
+func unquote(tok string) string {
+	if len(tok) >= 2 && tok[0] == '\'' && tok[len(tok)-1] == '\'' {
+		return tok[1 : len(tok)-1]
+	}
+
+	return tok
+}
+
+// compareOrdered evaluates the <, >, <=, and >= operators, trying a numeric
+// comparison between v and c.value first and falling back to RFC3339
+// timestamps.
+func (c condition) compareOrdered(v string) bool {
+	if a, err := strconv.ParseFloat(v, 64); err == nil {
+		if b, err := strconv.ParseFloat(c.value, 64); err == nil {
+			return c.op.apply(a < b, a == b, a > b)
+		}
+	}
+
+	if a, err := time.Parse(time.RFC3339, v); err == nil {
+		if b, err := time.Parse(time.RFC3339, c.value); err == nil {
+			return c.op.apply(a.Before(b), a.Equal(b), a.After(b))
+		}
+	}
+
+	return false
+}
+
+// apply picks the right outcome of an ordered comparison for the operator.
+func (o operator) apply(lt, eq, gt bool) bool {
+	switch o {
+	case opLT:
+		return lt
+	case opLTE:
+		return lt || eq
+	case opGT:
+		return gt
+	case opGTE:
+		return gt || eq
+	default:
+		return false
+	}
+}
@@ -0,0 +1,61 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmptyQueryMatchesEverything(t *testing.T) {
+	assert.True(t, Empty{}.Matches(nil))
+	assert.True(t, Empty{}.Matches(map[string]string{"tx.height": "5"}))
+}
+
+func TestParseQueryEquality(t *testing.T) {
+	q, err := ParseQuery("tx.hash = 'abc'")
+	assert.NoError(t, err)
+
+	assert.True(t, q.Matches(map[string]string{"tx.hash": "abc"}))
+	assert.False(t, q.Matches(map[string]string{"tx.hash": "def"}))
+}
+
+func TestParseQueryNumericComparison(t *testing.T) {
+	q, err := ParseQuery("tx.height > 5")
+	assert.NoError(t, err)
+
+	assert.True(t, q.Matches(map[string]string{"tx.height": "6"}))
+	assert.False(t, q.Matches(map[string]string{"tx.height": "5"}))
+	assert.False(t, q.Matches(map[string]string{"tx.height": "4"}))
+}
+
+func TestParseQueryAnd(t *testing.T) {
+	q, err := ParseQuery("tx.height > 5 AND tx.hash = 'abc'")
+	assert.NoError(t, err)
+
+	assert.True(t, q.Matches(map[string]string{"tx.height": "6", "tx.hash": "abc"}))
+	assert.False(t, q.Matches(map[string]string{"tx.height": "6", "tx.hash": "def"}))
+	assert.False(t, q.Matches(map[string]string{"tx.height": "4", "tx.hash": "abc"}))
+}
+
+func TestParseQueryContains(t *testing.T) {
+	q, err := ParseQuery("tx.tags CONTAINS 'urgent'")
+	assert.NoError(t, err)
+
+	assert.True(t, q.Matches(map[string]string{"tx.tags": "urgent,low-priority"}))
+	assert.False(t, q.Matches(map[string]string{"tx.tags": "low-priority"}))
+}
+
+func TestParseQueryMissingTagNeverMatches(t *testing.T) {
+	q, err := ParseQuery("tx.height > 5")
+	assert.NoError(t, err)
+
+	assert.False(t, q.Matches(map[string]string{}))
+}
+
+func TestParseQueryRejectsMalformedInput(t *testing.T) {
+	_, err := ParseQuery("tx.height >")
+	assert.Error(t, err)
+
+	_, err = ParseQuery("tx.height > 5 OR tx.hash = 'abc'")
+	assert.Error(t, err)
+}
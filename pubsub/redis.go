@@ -2,20 +2,34 @@ package pubsub
 
 import (
 	"sync"
+	"time"
 
+	"github.com/WatchBeam/redutil/metrics"
 	"github.com/garyburd/redigo/redis"
 )
 
+// subscription pairs a Listener with the Query that must match a published
+// event's tags before the Listener is invoked.
+type subscription struct {
+	query Query
+	l     Listener
+}
+
 type record struct {
 	name string
 	ev   Event
-	list []Listener
+	list []subscription
 }
 
-// Emit invokes all attached listeners with the provided event.
-func (r *record) Emit(ev Event, b []byte) {
-	for _, l := range r.list {
-		l.Handle(ev, b)
+// Emit invokes the attached listeners whose Query matches tags with the
+// provided event.
+func (r *record) Emit(ev Event, b []byte, tags map[string]string) {
+	for _, sub := range r.list {
+		if !sub.query.Matches(tags) {
+			continue
+		}
+
+		sub.l.Handle(ev, b)
 	}
 }
 
@@ -33,7 +47,7 @@ func (r *recordList) FindCopy(ev string) *record {
 	dup := &record{
 		ev:   rec.ev,
 		name: rec.name,
-		list: make([]Listener, len(rec.list)),
+		list: make([]subscription, len(rec.list)),
 	}
 
 	copy(dup.list, rec.list)
@@ -53,20 +67,20 @@ func (r *recordList) find(ev string) (index int, rec *record) {
 	return -1, nil
 }
 
-// Add inserts a new listener for an event. Returns the incremented
-// number of listeners.
-func (r *recordList) Add(ev Event, fn Listener) int {
+// Add inserts a new listener for an event, filtered by q. Returns the
+// incremented number of listeners.
+func (r *recordList) Add(ev Event, q Query, fn Listener) int {
 	idx, rec := r.find(ev.Name())
 	if idx == -1 {
 		r.list = append(r.list, &record{
 			ev:   ev,
 			name: ev.Name(),
-			list: []Listener{fn},
+			list: []subscription{{query: q, l: fn}},
 		})
 		return 1
 	}
 
-	rec.list = append(rec.list, fn)
+	rec.list = append(rec.list, subscription{query: q, l: fn})
 	return len(rec.list)
 }
 
@@ -78,11 +92,11 @@ func (r *recordList) Remove(ev Event, fn Listener) int {
 		return 0
 	}
 
-	for i, l := range rec.list {
-		if l == fn {
+	for i, sub := range rec.list {
+		if sub.l == fn {
 			// Annoying cut since the Listener is a pointer
 			rec.list[i] = rec.list[len(rec.list)-1]
-			rec.list[len(rec.list)-1] = nil
+			rec.list[len(rec.list)-1] = subscription{}
 			rec.list = rec.list[:len(rec.list)-1]
 			break
 		}
@@ -102,30 +116,45 @@ func (r *recordList) Remove(ev Event, fn Listener) int {
 // PubsubEmitter is an implementation of the Emitter interface using
 // Redis pupsub.
 type PubsubEmitter struct {
-	pool   *redis.Pool
-	errs   chan error
-	closer chan struct{}
-	send   chan command
+	pool     *redis.Pool
+	errs     chan error
+	closer   chan struct{}
+	send     chan command
+	reporter metrics.Reporter
 
 	// Lists of listeners for subscribers and pattern subscribers
 	subsMu sync.Mutex
 	subs   []*recordList
 }
 
+// Option configures optional behavior on a PubsubEmitter.
+type Option func(*PubsubEmitter)
+
+// WithReporter configures the PubsubEmitter to report operational metrics
+// through r. If unset, metrics.NoopReporter is used.
+func WithReporter(r metrics.Reporter) Option {
+	return func(p *PubsubEmitter) { p.reporter = r }
+}
+
 // NewPubsubEmitter creates a new Emitter based on pubsub on the provided
 // Redis pool.
-func NewPubsubEmitter(pool *redis.Pool) *PubsubEmitter {
+func NewPubsubEmitter(pool *redis.Pool, opts ...Option) *PubsubEmitter {
 	ps := &PubsubEmitter{
-		pool:   pool,
-		errs:   make(chan error),
-		closer: make(chan struct{}),
-		send:   make(chan command),
+		pool:     pool,
+		errs:     make(chan error),
+		closer:   make(chan struct{}),
+		send:     make(chan command),
+		reporter: metrics.NoopReporter{},
 		subs: []*recordList{
 			PlainEvent:   &recordList{},
 			PatternEvent: &recordList{},
 		},
 	}
 
+	for _, opt := range opts {
+		opt(ps)
+	}
+
 	go ps.work()
 
 	return ps
@@ -136,9 +165,10 @@ var _ Emitter = new(PubsubEmitter)
 // Inner working loop for the emitter, runs until .Close() is called.
 func (p *PubsubEmitter) work() {
 	var (
-		cnx   redis.Conn
-		read  *readPump
-		write *writePump
+		cnx     redis.Conn
+		read    *readPump
+		write   *writePump
+		started bool
 	)
 
 	teardown := func() {
@@ -152,6 +182,11 @@ func (p *PubsubEmitter) work() {
 
 	for {
 		if cnx == nil {
+			if started {
+				p.reporter.IncPubsubReconnects()
+			}
+			started = true
+
 			cnx = p.pool.Get()
 			read = newReadPump(cnx)
 			write = newWritePump(cnx)
@@ -210,16 +245,34 @@ func (p *PubsubEmitter) resubscribe() {
 }
 
 func (p *PubsubEmitter) handleEvent(data interface{}) {
+	start := time.Now()
+	defer func() { p.reporter.ObserveHandleEventDuration(time.Since(start)) }()
+
 	switch t := data.(type) {
 	case redis.Message:
+		p.reporter.IncPubsubMessagesReceived(PlainEvent.String())
+
 		p.subsMu.Lock()
 		rec := p.subs[PlainEvent].FindCopy(t.Channel)
 		p.subsMu.Unlock()
-		rec.Emit(rec.ev, t.Data)
+
+		payload, tags := decodeEnvelope(t.Data)
+		rec.Emit(rec.ev, payload, tags)
 
 	case redis.PMessage:
-		// todo
+		p.reporter.IncPubsubMessagesReceived(PatternEvent.String())
+
+		p.subsMu.Lock()
+		rec := p.subs[PatternEvent].FindCopy(t.Pattern)
+		p.subsMu.Unlock()
+
+		ev, ok := rec.ev.match(t.Channel)
+		if !ok {
+			return
+		}
 
+		payload, tags := decodeEnvelope(t.Data)
+		rec.Emit(ev, payload, tags)
 	}
 }
 
@@ -230,10 +283,20 @@ func (p *PubsubEmitter) Errs() <-chan error {
 
 // Subscribe implements Emitter.Subscribe
 func (p *PubsubEmitter) Subscribe(ev Event, l Listener) {
+	p.SubscribeWithQuery(ev, Empty{}, l)
+}
+
+// SubscribeWithQuery behaves like Subscribe, but additionally discards any
+// event whose tags, attached by the publisher via Publish, do not satisfy q.
+// Use ParseQuery to compile a tendermint-style expression such as
+// `tx.height > 5 AND tx.hash = 'abc'`, or pass Empty{} to match everything.
+func (p *PubsubEmitter) SubscribeWithQuery(ev Event, q Query, l Listener) {
 	p.subsMu.Lock()
-	count := p.subs[ev.Type()].Add(ev, l)
+	count := p.subs[ev.Type()].Add(ev, q, l)
 	p.subsMu.Unlock()
 
+	p.reporter.IncPubsubSubscribers(ev.Type().String(), 1)
+
 	if count == 1 {
 		p.send <- command{
 			command: ev.Type().SubCommand(),
@@ -242,12 +305,31 @@ func (p *PubsubEmitter) Subscribe(ev Event, l Listener) {
 	}
 }
 
+// Publish implements Emitter.Publish. It frames data together with tags into
+// the envelope handleEvent expects, so that SubscribeWithQuery listeners can
+// filter on them.
+func (p *PubsubEmitter) Publish(ev Event, data []byte, tags map[string]string) error {
+	payload, err := encodeEnvelope(data, tags)
+	if err != nil {
+		return err
+	}
+
+	p.send <- command{
+		command: "PUBLISH",
+		args:    []interface{}{ev.Name(), payload},
+	}
+
+	return nil
+}
+
 // Unsubscribe implements Emitter.Unsubscribe
 func (p *PubsubEmitter) Unsubscribe(ev Event, l Listener) {
 	p.subsMu.Lock()
 	count := p.subs[ev.Type()].Remove(ev, l)
 	p.subsMu.Unlock()
 
+	p.reporter.IncPubsubSubscribers(ev.Type().String(), -1)
+
 	if count == 0 {
 		p.send <- command{
 			command: ev.Type().UnsubCommand(),
@@ -0,0 +1,420 @@
+package pubsub
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WatchBeam/redutil/metrics"
+	"github.com/garyburd/redigo/redis"
+)
+
+// StreamAcker lets a Listener take explicit control of when a message
+// delivered by StreamEmitter is acknowledged, instead of having it acked
+// automatically as soon as Handle returns.
+type StreamAcker interface {
+	Listener
+
+	// HandleStream behaves like Listener.Handle, but additionally receives
+	// ack, which must be called once ev has been durably processed. Until
+	// then, msgID stays in the consumer group's pending entries list.
+	// StreamEmitter itself never reads or claims pending entries, so an
+	// entry left unacked is not delivered again by it.
+	HandleStream(ev Event, b []byte, msgID string, ack func() error)
+}
+
+// StreamEmitter is an Emitter backed by Redis Streams (XADD/XREADGROUP/
+// XACK) instead of pubsub. Where PubsubEmitter drops a message if no one is
+// listening at publish time, StreamEmitter's consumer group keeps entries
+// added after the group was created in the stream until a member reads
+// them, so entries published while no consumer is running are delivered
+// on the next read. Reads use XREADGROUP's ">" id, which returns only
+// entries never delivered to the group: an entry that was delivered but
+// not acked, e.g. because its consumer crashed, stays pending and is not
+// read again by any StreamEmitter.
+type StreamEmitter struct {
+	pool     *redis.Pool
+	group    string
+	consumer string
+	block    time.Duration
+
+	errs     chan error
+	closer   chan struct{}
+	reporter metrics.Reporter
+
+	subsMu sync.Mutex
+	subs   []*recordList
+
+	groupsMu sync.Mutex
+	groups   map[string]bool
+}
+
+var _ Emitter = new(StreamEmitter)
+
+// StreamOption configures optional behavior on a StreamEmitter.
+type StreamOption func(*StreamEmitter)
+
+// WithStreamReporter configures the StreamEmitter to report operational
+// metrics through r. If unset, metrics.NoopReporter is used.
+func WithStreamReporter(r metrics.Reporter) StreamOption {
+	return func(s *StreamEmitter) { s.reporter = r }
+}
+
+// NewStreamEmitter creates a StreamEmitter on pool. group and consumer name
+// the consumer group and this Emitter's member of it; each new entry is
+// delivered to only one member of group. Entries left pending by a member
+// are not re-read or claimed by this one.
+func NewStreamEmitter(pool *redis.Pool, group, consumer string, opts ...StreamOption) *StreamEmitter {
+	s := &StreamEmitter{
+		pool:     pool,
+		group:    group,
+		consumer: consumer,
+		block:    time.Second,
+		errs:     make(chan error),
+		closer:   make(chan struct{}),
+		reporter: metrics.NoopReporter{},
+		subs: []*recordList{
+			PlainEvent:   &recordList{},
+			PatternEvent: &recordList{},
+		},
+		groups: make(map[string]bool),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	go s.work()
+
+	return s
+}
+
+// Errs implements Emitter.Errs
+func (s *StreamEmitter) Errs() <-chan error { return s.errs }
+
+// Close implements Emitter.Close
+func (s *StreamEmitter) Close() { close(s.closer) }
+
+// Subscribe implements Emitter.Subscribe. A plain Event's Name() is used
+// directly as the stream key. A pattern Event's literal prefix, up to its
+// first Star() field, is periodically SCANned to discover matching stream
+// keys, so a stream created after Subscribe is called is picked up on the
+// next poll.
+func (s *StreamEmitter) Subscribe(ev Event, l Listener) {
+	s.subsMu.Lock()
+	s.subs[ev.Type()].Add(ev, Empty{}, l)
+	s.subsMu.Unlock()
+
+	s.reporter.IncPubsubSubscribers(ev.Type().String(), 1)
+
+	if ev.Type() == PlainEvent {
+		s.ensureGroup(ev.Name())
+	}
+}
+
+// Unsubscribe implements Emitter.Unsubscribe
+func (s *StreamEmitter) Unsubscribe(ev Event, l Listener) {
+	s.subsMu.Lock()
+	s.subs[ev.Type()].Remove(ev, l)
+	s.subsMu.Unlock()
+
+	s.reporter.IncPubsubSubscribers(ev.Type().String(), -1)
+}
+
+// Publish appends data and tags to ev's stream via XADD, creating the
+// stream if it doesn't yet exist.
+func (s *StreamEmitter) Publish(ev Event, data []byte, tags map[string]string) error {
+	payload, err := encodeEnvelope(data, tags)
+	if err != nil {
+		return err
+	}
+
+	cnx := s.pool.Get()
+	defer cnx.Close()
+
+	_, err = cnx.Do("XADD", ev.Name(), "*", "data", payload)
+	return err
+}
+
+// FireEvent implements Fireable, delegating to Publish with no tags
+// attached.
+func (s *StreamEmitter) FireEvent(ev Event, data []byte) error {
+	return s.Publish(ev, data, nil)
+}
+
+// ensureGroup creates the consumer group on key, creating the stream itself
+// (MKSTREAM) if it doesn't already exist. It's a no-op if the group is
+// already present, and remembers keys it has successfully ensured so that
+// re-matching the same key on a later poll - plain or pattern - doesn't
+// re-issue the XGROUP CREATE round-trip.
+func (s *StreamEmitter) ensureGroup(key string) {
+	s.groupsMu.Lock()
+	known := s.groups[key]
+	s.groupsMu.Unlock()
+
+	if known {
+		return
+	}
+
+	cnx := s.pool.Get()
+	defer cnx.Close()
+
+	_, err := cnx.Do("XGROUP", "CREATE", key, s.group, "$", "MKSTREAM")
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		s.reportErr(err)
+		return
+	}
+
+	s.groupsMu.Lock()
+	s.groups[key] = true
+	s.groupsMu.Unlock()
+}
+
+// streamTarget is a single concrete stream key StreamEmitter should poll,
+// together with the Event its entries should be dispatched as and a
+// snapshot of its listeners taken under subsMu.
+type streamTarget struct {
+	key  string
+	ev   Event
+	subs []subscription
+}
+
+// streamTargets resolves every currently-subscribed Event into the concrete
+// stream keys it covers: directly for plain events, and via a SCAN of the
+// pattern's prefix for pattern events.
+func (s *StreamEmitter) streamTargets(cnx redis.Conn) []streamTarget {
+	var targets []streamTarget
+
+	s.subsMu.Lock()
+	plain := append([]*record(nil), s.subs[PlainEvent].list...)
+	patterns := append([]*record(nil), s.subs[PatternEvent].list...)
+	s.subsMu.Unlock()
+
+	for _, rec := range plain {
+		// Re-ensure on every cycle, not just when Subscribe first runs it:
+		// pruneGroups, or the group being destroyed out of band, can forget
+		// a plain target's group just as easily as a pattern-matched one,
+		// and ensureGroup is a no-op once the key is memoized again.
+		s.ensureGroup(rec.name)
+
+		s.subsMu.Lock()
+		subs := append([]subscription(nil), rec.list...)
+		s.subsMu.Unlock()
+
+		targets = append(targets, streamTarget{key: rec.name, ev: rec.ev, subs: subs})
+	}
+
+	for _, rec := range patterns {
+		for _, key := range s.scan(cnx, rec.ev.prefix()+"*") {
+			ev, ok := rec.ev.match(key)
+			if !ok {
+				continue
+			}
+
+			s.ensureGroup(key)
+
+			s.subsMu.Lock()
+			subs := append([]subscription(nil), rec.list...)
+			s.subsMu.Unlock()
+
+			targets = append(targets, streamTarget{key: key, ev: ev, subs: subs})
+		}
+	}
+
+	s.pruneGroups(targets)
+
+	return targets
+}
+
+// pruneGroups drops memoized ensureGroup entries for keys that are no
+// longer among targets, so a pattern subscription scanning through
+// high-cardinality, short-lived keys doesn't grow s.groups without bound.
+func (s *StreamEmitter) pruneGroups(targets []streamTarget) {
+	live := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		live[t.key] = true
+	}
+
+	s.groupsMu.Lock()
+	for key := range s.groups {
+		if !live[key] {
+			delete(s.groups, key)
+		}
+	}
+	s.groupsMu.Unlock()
+}
+
+// scan lists every key matching pattern by walking a SCAN cursor to
+// completion.
+func (s *StreamEmitter) scan(cnx redis.Conn, pattern string) []string {
+	var (
+		cursor = "0"
+		keys   []string
+	)
+
+	for {
+		reply, err := redis.Values(cnx.Do("SCAN", cursor, "MATCH", pattern))
+		if err != nil {
+			s.reportErr(err)
+			return keys
+		}
+
+		var page []string
+		if _, err := redis.Scan(reply, &cursor, &page); err != nil {
+			s.reportErr(err)
+			return keys
+		}
+
+		keys = append(keys, page...)
+		if cursor == "0" {
+			return keys
+		}
+	}
+}
+
+// work polls every subscribed stream key with XREADGROUP until Close is
+// called, dispatching delivered entries to their Event's listeners.
+func (s *StreamEmitter) work() {
+	defer close(s.errs)
+
+	for {
+		select {
+		case <-s.closer:
+			return
+		default:
+		}
+
+		cnx := s.pool.Get()
+		targets := s.streamTargets(cnx)
+
+		if len(targets) == 0 {
+			cnx.Close()
+			time.Sleep(s.block)
+			continue
+		}
+
+		for _, t := range targets {
+			s.poll(cnx, t)
+		}
+
+		cnx.Close()
+	}
+}
+
+// pollBlock bounds how long a single XREADGROUP call may block the
+// connection work() is using to poll every target in turn. It's kept short,
+// rather than using s.block directly, so that one cycle through many
+// subscribed keys doesn't starve the later ones for up to s.block each.
+const pollBlock = 250 * time.Millisecond
+
+// poll issues a single XREADGROUP against t.key and dispatches whatever
+// entries come back to t's listeners.
+func (s *StreamEmitter) poll(cnx redis.Conn, t streamTarget) {
+	reply, err := redis.Values(cnx.Do("XREADGROUP",
+		"GROUP", s.group, s.consumer,
+		"COUNT", 100,
+		"BLOCK", int(pollBlock/time.Millisecond),
+		"STREAMS", t.key, ">",
+	))
+	if err == redis.ErrNil {
+		return
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "NOGROUP") {
+			// The group ensureGroup memoized as present is gone, e.g. the
+			// key expired and was recreated by a bare XADD, or the group
+			// was destroyed out of band. Forget it so the next poll
+			// re-issues XGROUP CREATE instead of spinning on NOGROUP.
+			s.groupsMu.Lock()
+			delete(s.groups, t.key)
+			s.groupsMu.Unlock()
+		}
+
+		s.reportErr(err)
+		return
+	}
+
+	for _, streamReply := range reply {
+		s.dispatch(t, streamReply)
+	}
+}
+
+// dispatch unpacks a single per-stream XREADGROUP reply and hands each
+// entry it contains to t's listeners, reporting one received message per
+// entry - a reply can carry more than one, since poll reads with COUNT 100 -
+// to match PubsubEmitter.handleEvent's per-message counting.
+func (s *StreamEmitter) dispatch(t streamTarget, streamReply interface{}) {
+	parts, err := redis.Values(streamReply, nil)
+	if err != nil || len(parts) != 2 {
+		return
+	}
+
+	entries, err := redis.Values(parts[1], nil)
+	if err != nil {
+		return
+	}
+
+	for _, raw := range entries {
+		s.reporter.IncPubsubMessagesReceived(t.ev.Type().String())
+
+		fields, err := redis.Values(raw, nil)
+		if err != nil || len(fields) != 2 {
+			continue
+		}
+
+		msgID, err := redis.String(fields[0], nil)
+		if err != nil {
+			continue
+		}
+
+		kv, err := redis.StringMap(fields[1], nil)
+		if err != nil {
+			continue
+		}
+
+		payload, tags := decodeEnvelope([]byte(kv["data"]))
+		s.dispatchEntry(t, msgID, payload, tags)
+	}
+}
+
+// dispatchEntry invokes every listener of t whose Query matches tags,
+// acknowledging msgID automatically once Handle returns unless the
+// listener is a StreamAcker that wants to ack it itself.
+func (s *StreamEmitter) dispatchEntry(t streamTarget, msgID string, payload []byte, tags map[string]string) {
+	// ack pulls its own connection from the pool rather than reusing cnx:
+	// a StreamAcker may call it well after this poll cycle returns cnx to
+	// the pool, by which point cnx may have been handed to, and be in use
+	// by, an unrelated caller.
+	ack := func() error {
+		cnx := s.pool.Get()
+		defer cnx.Close()
+
+		_, err := cnx.Do("XACK", t.key, s.group, msgID)
+		return err
+	}
+
+	for _, sub := range t.subs {
+		if !sub.query.Matches(tags) {
+			continue
+		}
+
+		if acker, ok := sub.l.(StreamAcker); ok {
+			acker.HandleStream(t.ev, payload, msgID, ack)
+			continue
+		}
+
+		sub.l.Handle(t.ev, payload)
+		if err := ack(); err != nil {
+			s.reportErr(err)
+		}
+	}
+}
+
+// reportErr forwards err on Errs(), dropping it instead of blocking if
+// nothing is currently receiving.
+func (s *StreamEmitter) reportErr(err error) {
+	select {
+	case s.errs <- err:
+	default:
+	}
+}
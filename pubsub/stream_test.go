@@ -0,0 +1,351 @@
+package pubsub
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/redutil/metrics"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventPrefixStopsAtFirstStar(t *testing.T) {
+	e := NewPatternEvent("user:", Star().As("id"), String(":msg"))
+	assert.Equal(t, "user:", e.prefix())
+}
+
+func TestEventPrefixOfPlainEventIsWholeName(t *testing.T) {
+	e := NewEvent("user:42:msg")
+	assert.Equal(t, "user:42:msg", e.prefix())
+}
+
+type recordingAcker struct {
+	acked []string
+}
+
+func (r *recordingAcker) Handle(ev Event, b []byte) {}
+
+func (r *recordingAcker) HandleStream(ev Event, b []byte, msgID string, ack func() error) {
+	r.acked = append(r.acked, msgID)
+	ack()
+}
+
+func TestRecordingAckerImplementsStreamAcker(t *testing.T) {
+	var _ StreamAcker = &recordingAcker{}
+}
+
+// listenerFunc adapts a plain func into a Listener, for tests that only
+// care about what was delivered and not about ack timing.
+type listenerFunc func(ev Event, b []byte)
+
+func (f listenerFunc) Handle(ev Event, b []byte) { f(ev, b) }
+
+// fakeConn is a minimal redis.Conn whose Do delegates to a scriptable
+// function, so StreamEmitter's Redis interactions can be exercised without
+// a real server.
+type fakeConn struct {
+	mu    sync.Mutex
+	do    func(cmd string, args ...interface{}) (interface{}, error)
+	calls []string
+}
+
+var _ redis.Conn = (*fakeConn)(nil)
+
+func (f *fakeConn) Close() error { return nil }
+func (f *fakeConn) Err() error   { return nil }
+
+func (f *fakeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, cmd)
+	f.mu.Unlock()
+
+	return f.do(cmd, args...)
+}
+
+func (f *fakeConn) Send(string, ...interface{}) error { return nil }
+func (f *fakeConn) Flush() error                      { return nil }
+func (f *fakeConn) Receive() (interface{}, error)     { return nil, nil }
+
+func (f *fakeConn) callCount(cmd string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, c := range f.calls {
+		if c == cmd {
+			n++
+		}
+	}
+
+	return n
+}
+
+// fakePool builds a *redis.Pool whose Dial always hands back the same
+// fakeConn, so assertions can inspect every command issued across however
+// many Get/Close pairs a test's code path makes.
+func fakePool(do func(cmd string, args ...interface{}) (interface{}, error)) (*redis.Pool, *fakeConn) {
+	fc := &fakeConn{do: do}
+	return &redis.Pool{MaxIdle: 1, Dial: func() (redis.Conn, error) { return fc, nil }}, fc
+}
+
+func newTestStreamEmitter(pool *redis.Pool) *StreamEmitter {
+	return &StreamEmitter{
+		pool:     pool,
+		group:    "g",
+		consumer: "c",
+		block:    time.Second,
+		errs:     make(chan error, 10),
+		closer:   make(chan struct{}),
+		reporter: metrics.NoopReporter{},
+		subs: []*recordList{
+			PlainEvent:   &recordList{},
+			PatternEvent: &recordList{},
+		},
+		groups: make(map[string]bool),
+	}
+}
+
+func TestStreamEmitterEnsureGroupIsMemoized(t *testing.T) {
+	pool, fc := fakePool(func(cmd string, args ...interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	s := newTestStreamEmitter(pool)
+
+	s.ensureGroup("stream-key")
+	s.ensureGroup("stream-key")
+
+	assert.Equal(t, 1, fc.callCount("XGROUP"))
+}
+
+func TestStreamEmitterEnsureGroupToleratesBusyGroup(t *testing.T) {
+	pool, fc := fakePool(func(cmd string, args ...interface{}) (interface{}, error) {
+		if cmd == "XGROUP" {
+			return nil, errors.New("BUSYGROUP Consumer Group name already exists")
+		}
+		return nil, nil
+	})
+	s := newTestStreamEmitter(pool)
+
+	s.ensureGroup("stream-key")
+	s.ensureGroup("stream-key")
+
+	assert.Equal(t, 1, fc.callCount("XGROUP"), "BUSYGROUP should still memoize the key")
+
+	select {
+	case err := <-s.errs:
+		t.Fatalf("unexpected error reported: %v", err)
+	default:
+	}
+}
+
+func TestStreamEmitterPollSelfHealsOnNoGroup(t *testing.T) {
+	pool, _ := fakePool(func(cmd string, args ...interface{}) (interface{}, error) {
+		if cmd == "XREADGROUP" {
+			return nil, errors.New("NOGROUP No such key 'stream-key' or consumer group 'g' in XREADGROUP with GROUP option")
+		}
+		return nil, nil
+	})
+	s := newTestStreamEmitter(pool)
+	s.groups["stream-key"] = true
+
+	cnx := s.pool.Get()
+	defer cnx.Close()
+
+	s.poll(cnx, streamTarget{key: "stream-key", ev: NewEvent("stream-key")})
+
+	assert.False(t, s.groups["stream-key"], "NOGROUP should have forgotten the memoized group")
+
+	select {
+	case err := <-s.errs:
+		assert.Contains(t, err.Error(), "NOGROUP")
+	default:
+		t.Fatal("expected the NOGROUP error to be reported on Errs()")
+	}
+}
+
+func TestStreamEmitterPollDispatchesEntriesAndAutoAcks(t *testing.T) {
+	entries := []interface{}{
+		[]interface{}{
+			[]byte("stream-key"),
+			[]interface{}{
+				[]interface{}{
+					[]byte("1-0"),
+					[]interface{}{[]byte("data"), []byte("payload")},
+				},
+			},
+		},
+	}
+
+	pool, fc := fakePool(func(cmd string, args ...interface{}) (interface{}, error) {
+		switch cmd {
+		case "XREADGROUP":
+			return entries, nil
+		case "XACK":
+			return int64(1), nil
+		default:
+			return nil, nil
+		}
+	})
+	s := newTestStreamEmitter(pool)
+
+	var got []Message
+	l := listenerFunc(func(ev Event, b []byte) {
+		got = append(got, Message{Event: ev, Data: b})
+	})
+
+	ev := NewEvent("stream-key")
+	target := streamTarget{key: "stream-key", ev: ev, subs: []subscription{{query: Empty{}, l: l}}}
+
+	cnx := s.pool.Get()
+	defer cnx.Close()
+	s.poll(cnx, target)
+
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, []byte("payload"), got[0].Data)
+	}
+	assert.Equal(t, 1, fc.callCount("XACK"))
+}
+
+func TestStreamEmitterDispatchEntryDefersAckForStreamAcker(t *testing.T) {
+	pool, fc := fakePool(func(cmd string, args ...interface{}) (interface{}, error) {
+		return int64(1), nil
+	})
+	s := newTestStreamEmitter(pool)
+
+	acker := &recordingAcker{}
+	ev := NewEvent("stream-key")
+	target := streamTarget{key: "stream-key", ev: ev, subs: []subscription{{query: Empty{}, l: acker}}}
+
+	s.dispatchEntry(target, "5-0", []byte("payload"), nil)
+
+	assert.Equal(t, []string{"5-0"}, acker.acked)
+	assert.Equal(t, 1, fc.callCount("XACK"))
+}
+
+func TestStreamEmitterDispatchEntryFiltersByQuery(t *testing.T) {
+	pool, _ := fakePool(func(cmd string, args ...interface{}) (interface{}, error) {
+		return int64(1), nil
+	})
+	s := newTestStreamEmitter(pool)
+
+	var got int
+	l := listenerFunc(func(Event, []byte) { got++ })
+
+	q, err := ParseQuery("tx.height > 5")
+	assert.NoError(t, err)
+
+	ev := NewEvent("stream-key")
+	target := streamTarget{key: "stream-key", ev: ev, subs: []subscription{{query: q, l: l}}}
+
+	s.dispatchEntry(target, "1-0", []byte("payload"), map[string]string{"tx.height": "1"})
+	assert.Zero(t, got)
+
+	s.dispatchEntry(target, "2-0", []byte("payload"), map[string]string{"tx.height": "9"})
+	assert.Equal(t, 1, got)
+}
+
+func TestStreamEmitterStreamTargetsResolvesPatternKeysViaScan(t *testing.T) {
+	pool, fc := fakePool(func(cmd string, args ...interface{}) (interface{}, error) {
+		switch cmd {
+		case "SCAN":
+			return []interface{}{[]byte("0"), []interface{}{[]byte("user:42:msg")}}, nil
+		default:
+			return nil, nil
+		}
+	})
+	s := newTestStreamEmitter(pool)
+
+	ev := NewPatternEvent("user:", Star().As("id"), String(":msg"))
+	s.subs[PatternEvent].Add(ev, Empty{}, listenerFunc(func(Event, []byte) {}))
+
+	cnx := s.pool.Get()
+	defer cnx.Close()
+
+	targets := s.streamTargets(cnx)
+
+	if assert.Len(t, targets, 1) {
+		assert.Equal(t, "user:42:msg", targets[0].key)
+		assert.Equal(t, "42", targets[0].ev.Find("id").String())
+	}
+	assert.Equal(t, 1, fc.callCount("XGROUP"), "ensureGroup should have created the group for the matched key")
+}
+
+func TestStreamEmitterStreamTargetsReEnsuresPlainGroupAfterNoGroup(t *testing.T) {
+	pool, fc := fakePool(func(cmd string, args ...interface{}) (interface{}, error) {
+		if cmd == "XREADGROUP" {
+			return nil, errors.New("NOGROUP No such key 'stream-key' or consumer group 'g' in XREADGROUP with GROUP option")
+		}
+		return nil, nil
+	})
+	s := newTestStreamEmitter(pool)
+	s.Subscribe(NewEvent("stream-key"), listenerFunc(func(Event, []byte) {}))
+
+	assert.Equal(t, 1, fc.callCount("XGROUP"), "Subscribe should have ensured the group once")
+
+	cnx := s.pool.Get()
+	defer cnx.Close()
+
+	for i := 0; i < 3; i++ {
+		for _, target := range s.streamTargets(cnx) {
+			s.poll(cnx, target)
+		}
+	}
+
+	assert.Greater(t, fc.callCount("XGROUP"), 1,
+		"a plain subscription's group forgotten after a NOGROUP error should be re-created on a later cycle, not left dead")
+}
+
+// recordingReporter overrides just IncPubsubMessagesReceived, deferring
+// everything else to NoopReporter.
+type recordingReporter struct {
+	metrics.NoopReporter
+	messagesReceived int
+}
+
+func (r *recordingReporter) IncPubsubMessagesReceived(string) { r.messagesReceived++ }
+
+func TestStreamEmitterDispatchCountsEachEntryReceived(t *testing.T) {
+	entries := []interface{}{
+		[]interface{}{
+			[]byte("stream-key"),
+			[]interface{}{
+				[]interface{}{[]byte("1-0"), []interface{}{[]byte("data"), []byte("one")}},
+				[]interface{}{[]byte("2-0"), []interface{}{[]byte("data"), []byte("two")}},
+			},
+		},
+	}
+
+	pool, _ := fakePool(func(cmd string, args ...interface{}) (interface{}, error) {
+		if cmd == "XREADGROUP" {
+			return entries, nil
+		}
+		return nil, nil
+	})
+	s := newTestStreamEmitter(pool)
+	reporter := &recordingReporter{}
+	s.reporter = reporter
+
+	ev := NewEvent("stream-key")
+	l := listenerFunc(func(Event, []byte) {})
+	target := streamTarget{key: "stream-key", ev: ev, subs: []subscription{{query: Empty{}, l: l}}}
+
+	cnx := s.pool.Get()
+	defer cnx.Close()
+	s.poll(cnx, target)
+
+	assert.Equal(t, 2, reporter.messagesReceived, "both entries in the XREADGROUP reply should be counted")
+}
+
+func TestStreamEmitterPruneGroupsDropsStaleKeys(t *testing.T) {
+	s := newTestStreamEmitter(nil)
+	s.groups["live"] = true
+	s.groups["stale"] = true
+
+	s.pruneGroups([]streamTarget{{key: "live"}})
+
+	assert.True(t, s.groups["live"])
+	_, stillThere := s.groups["stale"]
+	assert.False(t, stillThere)
+}
@@ -0,0 +1,50 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// envelope is the frame Publish puts onto a Redis channel so that tags can
+// travel alongside the payload without changing the Listener API.
+type envelope struct {
+	Tags map[string]string `json:"tags,omitempty"`
+	Data []byte            `json:"data"`
+}
+
+// envelopeMagic prefixes every payload framed by encodeEnvelope. Without it,
+// decodeEnvelope would have to guess whether a message is an envelope by
+// trying to json.Unmarshal it, and a raw payload that happens to already be
+// valid JSON (published by this process before Publish existed, or by any
+// other, possibly non-Go, publisher doing a plain PUBLISH) would be
+// misread as one, silently losing the real payload. The NUL bytes make the
+// prefix exceedingly unlikely to collide with a real message.
+var envelopeMagic = []byte("\x00redutil:envelope\x00")
+
+// encodeEnvelope frames data and tags for publishing.
+func encodeEnvelope(data []byte, tags map[string]string) ([]byte, error) {
+	body, err := json.Marshal(envelope{Tags: tags, Data: data})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]byte{}, envelopeMagic...), body...), nil
+}
+
+// decodeEnvelope unframes a message received over Redis pubsub. Only a
+// payload carrying envelopeMagic is treated as one; anything else -
+// including a message that predates the envelope, or one published by
+// something other than Publish - is returned unchanged with no tags, so
+// existing publishers keep working.
+func decodeEnvelope(b []byte) ([]byte, map[string]string) {
+	if !bytes.HasPrefix(b, envelopeMagic) {
+		return b, nil
+	}
+
+	var env envelope
+	if err := json.Unmarshal(b[len(envelopeMagic):], &env); err != nil {
+		return b, nil
+	}
+
+	return env.Data, env.Tags
+}
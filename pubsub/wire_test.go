@@ -0,0 +1,41 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelopeRoundTripsDataAndTags(t *testing.T) {
+	b, err := encodeEnvelope([]byte("hello"), map[string]string{"tx.height": "5"})
+	assert.NoError(t, err)
+
+	data, tags := decodeEnvelope(b)
+	assert.Equal(t, []byte("hello"), data)
+	assert.Equal(t, map[string]string{"tx.height": "5"}, tags)
+}
+
+func TestEnvelopeRoundTripsWithNilTags(t *testing.T) {
+	b, err := encodeEnvelope([]byte("hello"), nil)
+	assert.NoError(t, err)
+
+	data, tags := decodeEnvelope(b)
+	assert.Equal(t, []byte("hello"), data)
+	assert.Nil(t, tags)
+}
+
+func TestDecodeEnvelopePassesThroughRawJSONPayload(t *testing.T) {
+	raw := []byte(`{"user_id": 5, "action": "login"}`)
+
+	data, tags := decodeEnvelope(raw)
+	assert.Equal(t, raw, data)
+	assert.Nil(t, tags)
+}
+
+func TestDecodeEnvelopePassesThroughRawNonJSONPayload(t *testing.T) {
+	raw := []byte("not json at all")
+
+	data, tags := decodeEnvelope(raw)
+	assert.Equal(t, raw, data)
+	assert.Nil(t, tags)
+}